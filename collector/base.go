@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"strings"
+)
+
+// buildFQPrefix joins non-empty parts with "_", the same convention
+// prometheus.BuildFQName uses for namespace/subsystem/name. Unlike
+// BuildFQName it does not special-case an empty final part, so it can be
+// used to build a prefix that newBaseCollector then suffixes itself.
+func buildFQPrefix(parts ...string) string {
+	var nonEmpty []string
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, "_")
+}
+
+// scrapeDurationBuckets are tuned for Elasticsearch scrape latencies.
+var scrapeDurationBuckets = []float64{.01, .05, .1, .5, 1, 2, 5, 10}
+
+// baseCollector holds the metrics common to every collector in this
+// package: the up/total_scrapes/json_parse_failures triplet, a
+// scrape_duration_seconds histogram observed around the HTTP call and
+// JSON decode, and an exposition_errors_total counter for internal
+// errors (e.g. panics) that occur while emitting metrics.
+type baseCollector struct {
+	up                prometheus.Gauge
+	totalScrapes      prometheus.Counter
+	jsonParseFailures prometheus.Counter
+	scrapeDuration    prometheus.Histogram
+	expositionErrors  *prometheus.CounterVec
+}
+
+// newBaseCollector builds a baseCollector whose metric names are
+// fqPrefix suffixed with "_up", "_total_scrapes", etc. fqPrefix is
+// typically the result of buildFQPrefix(namespace, subsystem[, name]).
+func newBaseCollector(fqPrefix, upHelp string) baseCollector {
+	return baseCollector{
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: fqPrefix + "_up",
+			Help: upHelp,
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: fqPrefix + "_total_scrapes",
+			Help: fmt.Sprintf("Current total scrapes for %s.", fqPrefix),
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: fqPrefix + "_json_parse_failures",
+			Help: "Number of errors while parsing JSON.",
+		}),
+		scrapeDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    fqPrefix + "_scrape_duration_seconds",
+			Help:    fmt.Sprintf("Duration of the %s scrape, including the HTTP call and JSON decode.", fqPrefix),
+			Buckets: scrapeDurationBuckets,
+		}),
+		expositionErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: fqPrefix + "_exposition_errors_total",
+			Help: "Number of internal errors encountered while exposing metrics for this collector.",
+		}, []string{"reason"}),
+	}
+}
+
+func (b *baseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- b.up.Desc()
+	ch <- b.totalScrapes.Desc()
+	ch <- b.jsonParseFailures.Desc()
+	ch <- b.scrapeDuration.Desc()
+	b.expositionErrors.Describe(ch)
+}
+
+func (b *baseCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- b.up
+	ch <- b.totalScrapes
+	ch <- b.jsonParseFailures
+	ch <- b.scrapeDuration
+	b.expositionErrors.Collect(ch)
+}
+
+// recoverExpositionPanic is called via defer around a metric emit loop
+// so that a single bad field can't kill the whole scrape; it counts the
+// panic against expositionErrors instead of propagating it.
+func (b *baseCollector) recoverExpositionPanic() {
+	if r := recover(); r != nil {
+		b.expositionErrors.WithLabelValues("panic").Inc()
+	}
+}
@@ -0,0 +1,33 @@
+package collector
+
+import (
+	"flag"
+	"strings"
+)
+
+// stringList is a flag.Value that accumulates comma-separated values
+// across repeated or single invocations, e.g.
+// -es.tasks.actions=indices:data/write/bulk,indices:data/write/index.
+type stringList struct {
+	values []string
+}
+
+func (l *stringList) String() string {
+	return strings.Join(l.values, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	l.values = append(l.values, strings.Split(s, ",")...)
+	return nil
+}
+
+var tasksActions stringList
+
+func init() {
+	flag.Var(&tasksActions, "es.tasks.actions", "Action prefixes exported individually by the tasks collector. May be repeated or comma-separated. Everything else collapses to action=\"other\" to bound label cardinality; empty means everything collapses to \"other\". Note this only bounds the action label: the tasks_in_flight metric's parent label is the raw parent task id and is not bounded by this flag.")
+}
+
+// TasksActions returns the --es.tasks.actions allow-list.
+func TasksActions() []string {
+	return tasksActions.values
+}
@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"container/list"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sync"
+)
+
+// warningHeaderRE parses an RFC 7234 Warning header value, e.g.
+// `299 Elasticsearch-7.10.0 "[types removal] Specifying types in ... "`.
+var warningHeaderRE = regexp.MustCompile(`^(\d{3})\s+\S+\s+"((?:[^"\\]|\\.)*)"`)
+
+// DeprecationTracker inspects HTTP responses from Elasticsearch for
+// Warning headers (used by ES to flag deprecated APIs and removed
+// features), counts them per endpoint/warn-code as
+// es_deprecation_warnings_total, and logs each distinct
+// (endpoint, message) pair once via a small LRU dedup cache. It is
+// shared across collectors so that repeated warnings from the same
+// endpoint on every scrape don't spam the logs.
+type DeprecationTracker struct {
+	logger   *slog.Logger
+	warnings *prometheus.CounterVec
+
+	mu   sync.Mutex
+	seen *lruSet
+}
+
+// NewDeprecationTracker builds a DeprecationTracker. logged dedup state
+// is capped at capacity distinct (endpoint, message) pairs, evicting the
+// least recently seen once full.
+func NewDeprecationTracker(logger *slog.Logger, capacity int) *DeprecationTracker {
+	return &DeprecationTracker{
+		logger: logger,
+		warnings: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "es_deprecation_warnings_total",
+			Help: "Number of Elasticsearch deprecation/warning HTTP headers seen, by endpoint and warn-code.",
+		}, []string{"endpoint", "code"}),
+		seen: newLRUSet(capacity),
+	}
+}
+
+func (t *DeprecationTracker) Describe(ch chan<- *prometheus.Desc) {
+	t.warnings.Describe(ch)
+}
+
+func (t *DeprecationTracker) Collect(ch chan<- prometheus.Metric) {
+	t.warnings.Collect(ch)
+}
+
+// Observe inspects res for Warning headers returned for endpoint,
+// incrementing es_deprecation_warnings_total for each one and logging
+// the first occurrence of each distinct (endpoint, message) pair.
+func (t *DeprecationTracker) Observe(endpoint string, res *http.Response) {
+	for _, raw := range res.Header["Warning"] {
+		code, message := parseWarningHeader(raw)
+		if code == "" {
+			continue
+		}
+
+		t.warnings.WithLabelValues(endpoint, code).Inc()
+
+		if t.markSeen(endpoint + "\x00" + message) {
+			continue
+		}
+
+		t.logger.Warn("received deprecation warning from elasticsearch",
+			"endpoint", endpoint,
+			"code", code,
+			"warning", message,
+		)
+	}
+}
+
+// markSeen records key as seen and reports whether it had already been
+// recorded.
+func (t *DeprecationTracker) markSeen(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.seen.Contains(key) {
+		return true
+	}
+	t.seen.Add(key)
+	return false
+}
+
+func parseWarningHeader(raw string) (code, message string) {
+	m := warningHeaderRE.FindStringSubmatch(raw)
+	if m == nil {
+		return "", ""
+	}
+	return m[1], m[2]
+}
+
+// lruSet is a small fixed-capacity set with least-recently-used
+// eviction, used to dedup deprecation warning log lines without
+// growing unbounded over the lifetime of the exporter.
+type lruSet struct {
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+func newLRUSet(capacity int) *lruSet {
+	return &lruSet{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (s *lruSet) Contains(key string) bool {
+	el, ok := s.items[key]
+	if !ok {
+		return false
+	}
+	s.ll.MoveToFront(el)
+	return true
+}
+
+func (s *lruSet) Add(key string) {
+	if el, ok := s.items[key]; ok {
+		s.ll.MoveToFront(el)
+		return
+	}
+
+	el := s.ll.PushFront(key)
+	s.items[key] = el
+
+	if s.ll.Len() > s.capacity {
+		oldest := s.ll.Back()
+		if oldest != nil {
+			s.ll.Remove(oldest)
+			delete(s.items, oldest.Value.(string))
+		}
+	}
+}
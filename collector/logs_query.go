@@ -4,122 +4,276 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"path"
+	"text/template"
+	"time"
 )
 
-type networkDiscoveryErrorQueryMetric struct {
-	Type  prometheus.ValueType
-	Desc  *prometheus.Desc
-	Value func(response NetworkDiscoveryErrorQueryResponse) float64
+// SavedQueryMetric describes a single Prometheus metric to derive from a
+// saved query's response, either from the top-level hit count or from an
+// aggregation.
+type SavedQueryMetric struct {
+	// Name is appended to the query name to form the metric name, e.g.
+	// a query named "network_discovery_error" with metric name "total"
+	// produces "<namespace>_queries_network_discovery_error_total".
+	Name string `yaml:"name"`
+	Help string `yaml:"help"`
+	// Source is either "hits.total" or the name of an aggregation
+	// configured in Aggs below.
+	Source string `yaml:"source"`
+	// SubAgg is the name of a metric sub-aggregation (sum/avg/value_count)
+	// nested inside each bucket of a "terms" or "date_histogram" Source
+	// aggregation, e.g. "avg_latency" for a bucket that serializes as
+	// {"key":"a","doc_count":5,"avg_latency":{"value":42}}. When set, each
+	// bucket's value comes from that nested aggregation's value instead of
+	// the bucket's doc_count. Unused when Source has no buckets.
+	SubAgg string `yaml:"sub_agg"`
 }
 
-type LogsQueries struct {
-	logger log.Logger
-	client *http.Client
-	url    *url.URL
+// SavedQueryAgg describes an Elasticsearch aggregation to walk when
+// extracting metrics from a query response.
+type SavedQueryAgg struct {
+	Name string `yaml:"name"`
+	// Type is one of "terms", "date_histogram", "sum", "avg", "value_count".
+	Type string `yaml:"type"`
+	// LabelName is the label bucketed aggregations ("terms" or
+	// "date_histogram") expose their bucket key under. Unused for value
+	// aggregations ("sum", "avg", "value_count"), which have no buckets.
+	LabelName string `yaml:"label_name"`
+}
+
+// SavedQuery is a single named query loaded from the exporter's saved
+// search configuration file.
+type SavedQuery struct {
+	Name string `yaml:"name"`
+	// Index is the target index pattern, e.g. "elasticsearch-*".
+	Index string `yaml:"index"`
+	// Body is the query DSL body rendered as a Go template. The template
+	// is executed with a savedQueryTemplateData so that time windows such
+	// as "now-5m" can be parameterized off the scrape time.
+	Body  string           `yaml:"body"`
+	Aggs  []SavedQueryAgg  `yaml:"aggs"`
+	Metrics []SavedQueryMetric `yaml:"metrics"`
+
+	template *template.Template
+}
+
+// savedQueryTemplateData is exposed to a SavedQuery's Body template.
+type savedQueryTemplateData struct {
+	Now time.Time
+}
+
+// SavedQueriesConfig is the top-level shape of the YAML file passed to
+// NewLogsQueries.
+type SavedQueriesConfig struct {
+	Queries []SavedQuery `yaml:"queries"`
+}
+
+// LoadSavedQueriesConfig parses a saved-search configuration file and
+// pre-compiles each query's body template.
+func LoadSavedQueriesConfig(data []byte) (*SavedQueriesConfig, error) {
+	var cfg SavedQueriesConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse saved queries config: %s", err)
+	}
+
+	for i := range cfg.Queries {
+		q := &cfg.Queries[i]
+		tmpl, err := template.New(q.Name).Parse(q.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse body template for query %q: %s", q.Name, err)
+		}
+		q.template = tmpl
+	}
+
+	return &cfg, nil
+}
+
+// savedQueryResult is the generic decode target for a saved query
+// response: it captures hits.total plus the raw aggregations so terms
+// buckets, date_histogram buckets and metric sub-aggregations can all be
+// walked without a fixed schema.
+type savedQueryResult struct {
+	Hits struct {
+		Total int `json:"total"`
+	} `json:"hits"`
+	Aggregations map[string]json.RawMessage `json:"aggregations"`
+}
+
+// aggBucket is one bucket of a terms/date_histogram aggregation. Nested
+// metric sub-aggregations (e.g. a named "avg_latency" aggregation) are
+// not fixed fields; they are captured in raw and picked out by name via
+// bucketSubAggValue.
+type aggBucket struct {
+	Key      json.RawMessage `json:"key"`
+	KeyAsStr string          `json:"key_as_string"`
+	DocCount float64         `json:"doc_count"`
+
+	raw map[string]json.RawMessage
+}
 
-	up                              prometheus.Gauge
-	totalScrapes, jsonParseFailures prometheus.Counter
+// UnmarshalJSON decodes the fixed bucket fields while also retaining the
+// raw object so named metric sub-aggregations nested in the bucket can
+// be looked up later by name.
+func (b *aggBucket) UnmarshalJSON(data []byte) error {
+	type plainBucket aggBucket
+	var decoded plainBucket
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*b = aggBucket(decoded)
 
-	networkDiscoveryErrorQueryMetrics []*networkDiscoveryErrorQueryMetric
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	b.raw = raw
+	return nil
 }
 
-func NewLogsQueries(logger log.Logger, client *http.Client, url *url.URL) *LogsQueries {
+// bucketSubAggValue looks up a named metric sub-aggregation nested
+// inside bucket, e.g. subAgg "avg_latency" against
+// {"avg_latency":{"value":42}}.
+func bucketSubAggValue(bucket aggBucket, subAgg string) (float64, bool) {
+	if subAgg == "" {
+		return 0, false
+	}
+
+	raw, ok := bucket.raw[subAgg]
+	if !ok {
+		return 0, false
+	}
+
+	var sub struct {
+		Value *float64 `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &sub); err != nil || sub.Value == nil {
+		return 0, false
+	}
+	return *sub.Value, true
+}
+
+type aggResult struct {
+	Value   *float64    `json:"value"`
+	Buckets []aggBucket `json:"buckets"`
+}
+
+// queryCollector holds the per-query state (its config, up/scrapes/parse
+// failure triplet, and the gauge vecs derived from its metrics) needed
+// to scrape and expose one saved query. Every metric is a gauge, even
+// one sourced from a date_histogram: each scrape's query window (e.g.
+// "now-5m") typically overlaps the previous one, so the same bucket is
+// re-fetched on consecutive scrapes and must be re-set rather than
+// accumulated, or its value would inflate with every overlapping scrape.
+type queryCollector struct {
+	baseCollector
+
+	query SavedQuery
+
+	gauges map[string]*prometheus.GaugeVec
+}
+
+type LogsQueries struct {
+	logger      *slog.Logger
+	client      *http.Client
+	url         *url.URL
+	deprecation *DeprecationTracker
+
+	queries []*queryCollector
+}
+
+// NewLogsQueries builds a LogsQueries collector from a saved-search
+// configuration. Each configured query gets its own up/total_scrapes/
+// json_parse_failures triplet plus one gauge vec per metric.
+func NewLogsQueries(logger *slog.Logger, client *http.Client, url *url.URL, cfg *SavedQueriesConfig, deprecation *DeprecationTracker) *LogsQueries {
 	subsystem := "queries"
 
-	return &LogsQueries{
-		logger: logger,
-		client: client,
-		url:    url,
-
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "up"),
-			Help: "Was the last scrape of the ElasticSearch tasks endpoint successful.",
-		}),
-		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
-			Help: "Current total ElasticSearch tasks scrapes.",
-		}),
-		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
-			Help: "Number of errors while parsing JSON.",
-		}),
-
-		networkDiscoveryErrorQueryMetrics: []*networkDiscoveryErrorQueryMetric{
-			{
-				Type: prometheus.GaugeValue,
-				Desc: prometheus.NewDesc(
-					prometheus.BuildFQName(namespace, subsystem, "total_network_discovery_error"),
-					"Number of total network discovery",
-					nil, nil,
-				),
-				Value: func(response NetworkDiscoveryErrorQueryResponse) float64 {
-					return float64(response.Hits.Total)
-				},
-			},
-		},
+	lq := &LogsQueries{
+		logger:      logger,
+		client:      client,
+		url:         url,
+		deprecation: deprecation,
 	}
+
+	for _, q := range cfg.Queries {
+		qc := &queryCollector{
+			baseCollector: newBaseCollector(
+				buildFQPrefix(namespace, subsystem, q.Name),
+				fmt.Sprintf("Was the last scrape of the %q saved query successful.", q.Name),
+			),
+			query:  q,
+			gauges: map[string]*prometheus.GaugeVec{},
+		}
+
+		for _, m := range q.Metrics {
+			metricName := prometheus.BuildFQName(namespace, subsystem, q.Name+"_"+m.Name)
+			labels := metricLabelNames(q.Aggs, m.Source)
+			qc.gauges[m.Name] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: metricName,
+				Help: m.Help,
+			}, labels)
+		}
+
+		lq.queries = append(lq.queries, qc)
+	}
+
+	return lq
+}
+
+// metricLabelNames returns the label names a metric's gauge vec
+// needs, derived from that metric's own Source rather than from the
+// query as a whole: "hits.total" and value aggregations (sum/avg/
+// value_count) need none, while a bucketed aggregation (terms or
+// date_histogram) contributes its LabelName as a single label.
+func metricLabelNames(aggs []SavedQueryAgg, source string) []string {
+	if source == "hits.total" {
+		return nil
+	}
+	for _, a := range aggs {
+		if a.Name != source {
+			continue
+		}
+		switch a.Type {
+		case "terms", "date_histogram":
+			return []string{a.LabelName}
+		}
+	}
+	return nil
 }
 
 func (s *LogsQueries) Describe(ch chan<- *prometheus.Desc) {
-	for _, metric := range s.networkDiscoveryErrorQueryMetrics {
-		ch <- metric.Desc
-	}
-	ch <- s.up.Desc()
-	ch <- s.totalScrapes.Desc()
-	ch <- s.jsonParseFailures.Desc()
-}
-
-func (s *LogsQueries) getNetworkDiscoveryReq(u *url.URL) (*http.Response, error) {
-	var jsonStr = []byte(`{
-	"query": {
-		"bool": {
-			"must": [{
-				"match_all": {}
-			}, {
-				"bool": {
-					"should": [{
-						"match_phrase": {
-							"message": "send message failed"
-						}
-					}, {
-						"match_phrase": {
-							"message": "NodeNotConnectedException"
-						}
-					}]
-				}
-			}, {
-				"range": {
-					"@timestamp": {
-						"gt" :  "now-5m",
-						"format": "epoch_millis"
-					}
-				}
-			}],
-			"must_not": [{
-				"match_phrase": {
-					"message": {
-						"query": "0.0.0.0"
-					}
-				}
-			}]
+	for _, qc := range s.queries {
+		qc.baseCollector.Describe(ch)
+		for _, g := range qc.gauges {
+			g.Describe(ch)
 		}
 	}
-}`)
-	req, _ := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonStr))
-	req.Header.Set("Content-Type", "application/json")
+}
 
-	client := &http.Client{}
-	return client.Do(req)
+// renderBody executes a saved query's body template against the current
+// scrape time, so windows like "now-5m" can be parameterized.
+func renderBody(q SavedQuery, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := q.template.Execute(&buf, savedQueryTemplateData{Now: now}); err != nil {
+		return nil, fmt.Errorf("failed to render body for query %q: %s", q.Name, err)
+	}
+	return buf.Bytes(), nil
 }
 
-func (s *LogsQueries) getAndParseURL(u *url.URL, data interface{}) error {
-	res, err := s.getNetworkDiscoveryReq(u)
+func (s *LogsQueries) getAndParseURL(u *url.URL, endpoint string, body []byte, data interface{}, jsonParseFailures prometheus.Counter) error {
+	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request for %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -128,62 +282,165 @@ func (s *LogsQueries) getAndParseURL(u *url.URL, data interface{}) error {
 	defer func() {
 		err = res.Body.Close()
 		if err != nil {
-			_ = level.Warn(s.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
+			s.logger.Warn("failed to close http.Client", "err", err)
 		}
 	}()
 
+	if s.deprecation != nil {
+		s.deprecation.Observe(endpoint, res)
+	}
+
 	if res.StatusCode != http.StatusOK {
 		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
 	}
 
 	if err := json.NewDecoder(res.Body).Decode(data); err != nil {
-		s.jsonParseFailures.Inc()
+		jsonParseFailures.Inc()
 		return err
 	}
 	return nil
 }
 
-func (s *LogsQueries) fetchAndDecodeTasks() (NetworkDiscoveryErrorQueryResponse, error) {
+func (s *LogsQueries) fetchAndDecodeQuery(qc *queryCollector) (savedQueryResult, error) {
 	u := *s.url
-	u.Path = path.Join(u.Path, "/elasticsearch-*/_search")
-	var srr NetworkDiscoveryErrorQueryResponse
-	err := s.getAndParseURL(&u, &srr)
+	u.Path = path.Join(u.Path, "/"+qc.query.Index+"/_search")
 
+	body, err := renderBody(qc.query, time.Now())
 	if err != nil {
+		return savedQueryResult{}, err
+	}
+
+	var srr savedQueryResult
+	if err := s.getAndParseURL(&u, "/"+qc.query.Index+"/_search", body, &srr, qc.jsonParseFailures); err != nil {
 		return srr, err
 	}
 
 	return srr, nil
 }
 
-func (s *LogsQueries) Collect(ch chan<- prometheus.Metric) {
-	var err error
-	s.totalScrapes.Inc()
+// collectQuery scrapes a single saved query and pushes its up/scrape/
+// parse-failure triplet plus any hits.total or aggregation-derived
+// metrics onto ch.
+func (s *LogsQueries) collectQuery(qc *queryCollector, ch chan<- prometheus.Metric) {
+	qc.totalScrapes.Inc()
 	defer func() {
-		ch <- s.up
-		ch <- s.totalScrapes
-		ch <- s.jsonParseFailures
+		qc.baseCollector.Collect(ch)
 	}()
 
-	networkDiscoveryResp, err := s.fetchAndDecodeTasks()
+	start := time.Now()
+	result, err := s.fetchAndDecodeQuery(qc)
+	qc.scrapeDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
-		s.up.Set(0)
-		_ = level.Warn(s.logger).Log(
-			"msg", "failed to fetch and decode tasks",
+		qc.up.Set(0)
+		s.logger.Warn("failed to fetch and decode saved query",
+			"query", qc.query.Name,
 			"err", err,
 		)
 		return
 	}
-	s.up.Set(1)
+	qc.up.Set(1)
 
-	for _, metric := range s.networkDiscoveryErrorQueryMetrics {
-		ch <- prometheus.MustNewConstMetric(
-			metric.Desc,
-			metric.Type,
-			metric.Value(networkDiscoveryResp),
-		)
+	func() {
+		defer qc.recoverExpositionPanic()
+
+		for _, m := range qc.query.Metrics {
+			if m.Source == "hits.total" {
+				if g, ok := qc.gauges[m.Name]; ok {
+					g.WithLabelValues().Set(float64(result.Hits.Total))
+				}
+				continue
+			}
+
+			raw, ok := result.Aggregations[m.Source]
+			if !ok {
+				s.logger.Warn("saved query metric references unknown aggregation",
+					"query", qc.query.Name,
+					"metric", m.Name,
+					"source", m.Source,
+				)
+				continue
+			}
+
+			if err := applyAggMetric(qc, m, raw); err != nil {
+				s.logger.Warn("failed to apply saved query aggregation metric",
+					"query", qc.query.Name,
+					"metric", m.Name,
+					"err", err,
+				)
+			}
+		}
+	}()
+
+	for _, g := range qc.gauges {
+		g.Collect(ch)
+	}
+}
+
+// applyAggMetric decodes one aggregation result and drives the metric's
+// gauge vec from it: terms and date_histogram buckets become label
+// dimensions, each re-Set from the current response on every scrape
+// (never accumulated, since overlapping query windows would otherwise
+// double-count a bucket seen across consecutive scrapes). A bucket's
+// value is its doc_count, unless m.SubAgg names a nested metric
+// sub-aggregation, in which case that sub-aggregation's value is used
+// instead.
+func applyAggMetric(qc *queryCollector, m SavedQueryMetric, raw json.RawMessage) error {
+	var agg aggResult
+	if err := json.Unmarshal(raw, &agg); err != nil {
+		return fmt.Errorf("failed to decode aggregation %q: %s", m.Source, err)
+	}
+
+	g, ok := qc.gauges[m.Name]
+	if !ok {
+		return nil
+	}
+
+	if len(agg.Buckets) == 0 {
+		if agg.Value == nil {
+			return fmt.Errorf("aggregation %q has neither buckets nor a value", m.Source)
+		}
+		g.WithLabelValues().Set(*agg.Value)
+		return nil
+	}
+
+	for _, bucket := range agg.Buckets {
+		label := bucketLabel(bucket)
+
+		value := bucket.DocCount
+		if v, ok := bucketSubAggValue(bucket, m.SubAgg); ok {
+			value = v
+		}
+		g.WithLabelValues(label).Set(value)
+	}
+
+	return nil
+}
+
+// bucketLabel extracts a bucket's key as a label value. Elasticsearch
+// only populates key_as_string for date_histogram buckets (formatted
+// dates) and some numeric terms; for keyword/text terms the key is a
+// bare JSON string, so it has to be decoded rather than stringified, or
+// the label ends up wrapped in its original JSON quoting.
+func bucketLabel(bucket aggBucket) string {
+	if bucket.KeyAsStr != "" {
+		return bucket.KeyAsStr
+	}
+
+	var s string
+	if err := json.Unmarshal(bucket.Key, &s); err == nil {
+		return s
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(bucket.Key, &n); err == nil {
+		return n.String()
+	}
+
+	return string(bucket.Key)
+}
+
+func (s *LogsQueries) Collect(ch chan<- prometheus.Metric) {
+	for _, qc := range s.queries {
+		s.collectQuery(qc, ch)
 	}
 }
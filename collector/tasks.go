@@ -3,14 +3,19 @@ package collector
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
+	"time"
 )
 
+// runningTimeBuckets are the upper bounds, in seconds, of the fixed
+// buckets used for tasks_running_time_seconds_bucket.
+var runningTimeBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
 type taskMetric struct {
 	Type  prometheus.ValueType
 	Desc  *prometheus.Desc
@@ -18,36 +23,43 @@ type taskMetric struct {
 }
 
 type Tasks struct {
-	logger log.Logger
-	client *http.Client
-	url    *url.URL
+	baseCollector
 
-	up                              prometheus.Gauge
-	totalScrapes, jsonParseFailures prometheus.Counter
+	logger      *slog.Logger
+	client      *http.Client
+	url         *url.URL
+	deprecation *DeprecationTracker
 
 	taskMetrics []*taskMetric
+
+	// actions is the allow-list of action prefixes (--es.tasks.actions)
+	// that are exported individually; everything else collapses to
+	// action="other" to bound label cardinality.
+	actions []string
+
+	tasksInFlight      *prometheus.GaugeVec
+	tasksRunningBucket *prometheus.GaugeVec
+	tasksOldestRunning *prometheus.GaugeVec
 }
 
-func NewTasks(logger log.Logger, client *http.Client, url *url.URL) *Tasks {
+// NewTasks builds a Tasks collector. actions is the allow-list of action
+// prefixes (--es.tasks.actions, see TasksActions) that get their own
+// label value; any task whose action does not match one of these
+// prefixes is reported under action="other" to keep cardinality bounded.
+func NewTasks(logger *slog.Logger, client *http.Client, url *url.URL, actions []string, deprecation *DeprecationTracker) *Tasks {
 	subsystem := "tasks"
 
 	return &Tasks{
-		logger: logger,
-		client: client,
-		url:    url,
-
-		up: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "up"),
-			Help: "Was the last scrape of the ElasticSearch tasks endpoint successful.",
-		}),
-		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "total_scrapes"),
-			Help: "Current total ElasticSearch tasks scrapes.",
-		}),
-		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: prometheus.BuildFQName(namespace, subsystem, "json_parse_failures"),
-			Help: "Number of errors while parsing JSON.",
-		}),
+		baseCollector: newBaseCollector(
+			buildFQPrefix(namespace, subsystem),
+			"Was the last scrape of the ElasticSearch tasks endpoint successful.",
+		),
+
+		logger:      logger,
+		client:      client,
+		url:         url,
+		actions:     actions,
+		deprecation: deprecation,
 
 		taskMetrics: []*taskMetric{
 			{
@@ -90,16 +102,49 @@ func NewTasks(logger log.Logger, client *http.Client, url *url.URL) *Tasks {
 				},
 			},
 		},
+
+		// The "parent" label is the raw parent task id: unlike "action"
+		// it is not bounded by --es.tasks.actions, so its cardinality
+		// scales with the number of concurrently in-flight parent tasks.
+		tasksInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "in_flight"),
+			Help: "Number of in-flight tasks per node, action, type and parent. The parent label is not bounded by --es.tasks.actions and its cardinality scales with the number of in-flight parent tasks.",
+		}, []string{"node", "action", "type", "parent"}),
+
+		tasksRunningBucket: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "running_time_seconds_bucket"),
+			Help: "Point-in-time count of currently in-flight tasks with a running time less than or equal to le, per action. Rebuilt from the current task list on every scrape; not a cumulative histogram.",
+		}, []string{"action", "le"}),
+
+		tasksOldestRunning: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, subsystem, "oldest_running_seconds"),
+			Help: "Running time in seconds of the oldest in-flight task, per node and action.",
+		}, []string{"node", "action"}),
+	}
+}
+
+// allowedAction collapses an action to "other" unless it matches one of
+// the configured --es.tasks.actions prefixes, to bound label cardinality.
+func (s *Tasks) allowedAction(action string) string {
+	if len(s.actions) == 0 {
+		return "other"
+	}
+	for _, prefix := range s.actions {
+		if strings.HasPrefix(action, prefix) {
+			return action
+		}
 	}
+	return "other"
 }
 
 func (s *Tasks) Describe(ch chan<- *prometheus.Desc) {
 	for _, metric := range s.taskMetrics {
 		ch <- metric.Desc
 	}
-	ch <- s.up.Desc()
-	ch <- s.totalScrapes.Desc()
-	ch <- s.jsonParseFailures.Desc()
+	s.baseCollector.Describe(ch)
+	s.tasksInFlight.Describe(ch)
+	s.tasksRunningBucket.Describe(ch)
+	s.tasksOldestRunning.Describe(ch)
 }
 
 func (s *Tasks) getAndParseURL(u *url.URL, data interface{}) error {
@@ -112,13 +157,14 @@ func (s *Tasks) getAndParseURL(u *url.URL, data interface{}) error {
 	defer func() {
 		err = res.Body.Close()
 		if err != nil {
-			_ = level.Warn(s.logger).Log(
-				"msg", "failed to close http.Client",
-				"err", err,
-			)
+			s.logger.Warn("failed to close http.Client", "err", err)
 		}
 	}()
 
+	if s.deprecation != nil {
+		s.deprecation.Observe("_tasks", res)
+	}
+
 	if res.StatusCode != http.StatusOK {
 		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
 	}
@@ -143,31 +189,80 @@ func (s *Tasks) fetchAndDecodeTasks() (TasksResponse, error) {
 	return srr, nil
 }
 
+func formatBucketBound(bound float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%f", bound), "0"), ".")
+}
+
+// collectTaskBreakdown resets and repopulates the per-action/per-node
+// gauge vecs from the raw tasks response.
+func (s *Tasks) collectTaskBreakdown(tasks TasksResponse) {
+	s.tasksInFlight.Reset()
+	s.tasksRunningBucket.Reset()
+	s.tasksOldestRunning.Reset()
+
+	oldestByNodeAction := map[[2]string]float64{}
+	bucketCounts := map[[2]string]float64{}
+
+	for nodeID, node := range tasks.Nodes {
+		for _, task := range node.Tasks {
+			action := s.allowedAction(task.Action)
+			seconds := float64(task.RunningTimeInNanos) / 1e9
+
+			s.tasksInFlight.WithLabelValues(nodeID, action, task.Type, task.ParentTaskId).Inc()
+
+			for _, bound := range runningTimeBuckets {
+				if seconds <= bound {
+					bucketCounts[[2]string{action, formatBucketBound(bound)}]++
+				}
+			}
+			bucketCounts[[2]string{action, "+Inf"}]++
+
+			key := [2]string{nodeID, action}
+			if seconds > oldestByNodeAction[key] {
+				oldestByNodeAction[key] = seconds
+			}
+		}
+	}
+
+	for key, count := range bucketCounts {
+		s.tasksRunningBucket.WithLabelValues(key[0], key[1]).Set(count)
+	}
+	for key, seconds := range oldestByNodeAction {
+		s.tasksOldestRunning.WithLabelValues(key[0], key[1]).Set(seconds)
+	}
+}
+
 func (s *Tasks) Collect(ch chan<- prometheus.Metric) {
 	var err error
 	s.totalScrapes.Inc()
 	defer func() {
-		ch <- s.up
-		ch <- s.totalScrapes
-		ch <- s.jsonParseFailures
+		s.baseCollector.Collect(ch)
 	}()
 
+	start := time.Now()
 	tasksResp, err := s.fetchAndDecodeTasks()
+	s.scrapeDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
 		s.up.Set(0)
-		_ = level.Warn(s.logger).Log(
-			"msg", "failed to fetch and decode tasks",
-			"err", err,
-		)
+		s.logger.Warn("failed to fetch and decode tasks", "err", err)
 		return
 	}
 	s.up.Set(1)
 
-	for _, metric := range s.taskMetrics {
-		ch <- prometheus.MustNewConstMetric(
-			metric.Desc,
-			metric.Type,
-			metric.Value(tasksResp),
-		)
-	}
+	func() {
+		defer s.recoverExpositionPanic()
+
+		for _, metric := range s.taskMetrics {
+			ch <- prometheus.MustNewConstMetric(
+				metric.Desc,
+				metric.Type,
+				metric.Value(tasksResp),
+			)
+		}
+	}()
+
+	s.collectTaskBreakdown(tasksResp)
+	s.tasksInFlight.Collect(ch)
+	s.tasksRunningBucket.Collect(ch)
+	s.tasksOldestRunning.Collect(ch)
 }
@@ -0,0 +1,58 @@
+package control
+
+import (
+	"flag"
+	"strings"
+	"time"
+)
+
+// stringList is a flag.Value that accumulates comma-separated values
+// across repeated or single invocations, e.g.
+// -es.tasks.cancel.actions=indices:data/write/bulk,indices:data/write/index.
+type stringList struct {
+	values []string
+}
+
+func (l *stringList) String() string {
+	return strings.Join(l.values, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	l.values = append(l.values, strings.Split(s, ",")...)
+	return nil
+}
+
+var (
+	cancelEnabled      = flag.Bool("es.tasks.cancel.enabled", false, "Enable the /control/tasks/cancel endpoint and background reaper. Off by default.")
+	cancelConfirmed    = flag.Bool("web.enable-lifecycle", false, "Confirm enabling lifecycle-affecting endpoints such as /control/tasks/cancel. Required in addition to --es.tasks.cancel.enabled.")
+	cancelMaxRunning   = flag.Duration("es.tasks.cancel.max_running", 5*time.Minute, "Cancel cancellable tasks whose running time exceeds this threshold.")
+	cancelAllowActions stringList
+	cancelDenyActions  stringList
+)
+
+func init() {
+	flag.Var(&cancelAllowActions, "es.tasks.cancel.actions", "Action prefixes eligible for cancellation. May be repeated or comma-separated. Empty means all actions are eligible.")
+	flag.Var(&cancelDenyActions, "es.tasks.cancel.deny-actions", "Action prefixes excluded from cancellation, overriding --es.tasks.cancel.actions. May be repeated or comma-separated.")
+}
+
+// Enabled reports whether the cancel endpoint and reaper should actually
+// run: both --es.tasks.cancel.enabled and the --web.enable-lifecycle
+// confirmation must be set.
+func Enabled() bool {
+	return *cancelEnabled && *cancelConfirmed
+}
+
+// MaxRunning returns the --es.tasks.cancel.max_running threshold.
+func MaxRunning() time.Duration {
+	return *cancelMaxRunning
+}
+
+// AllowActions returns the --es.tasks.cancel.actions allow-list.
+func AllowActions() []string {
+	return cancelAllowActions.values
+}
+
+// DenyActions returns the --es.tasks.cancel.deny-actions deny-list.
+func DenyActions() []string {
+	return cancelDenyActions.values
+}
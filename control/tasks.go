@@ -0,0 +1,233 @@
+// Package control exposes HTTP endpoints that let an operator act on
+// live Elasticsearch state, as opposed to the read-only collectors in
+// package collector.
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hepsiburada/elasticsearch_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// cancelResult is one outcome of a single cancellation attempt, returned
+// as part of the JSON response body of POST /control/tasks/cancel.
+type cancelResult struct {
+	TaskID string `json:"task_id"`
+	Node   string `json:"node"`
+	Action string `json:"action"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// TasksCanceller implements the /control/tasks/cancel handler and an
+// optional background reaper that cancels long-running, cancellable
+// Elasticsearch tasks. It is off by default: both the HTTP handler and
+// the reaper refuse to act unless enabled is true.
+type TasksCanceller struct {
+	logger *slog.Logger
+	client *http.Client
+	url    *url.URL
+
+	enabled    bool
+	maxRunning time.Duration
+	allow      []string
+	deny       []string
+
+	attempts *prometheus.CounterVec
+}
+
+// NewTasksCanceller builds a TasksCanceller. client is the same
+// *http.Client used for scrapes, so cancellation requests inherit
+// whatever auth/TLS configuration the exporter was started with.
+// allow/deny are action-prefix lists (as with --es.tasks.actions); an
+// empty allow list matches every action.
+func NewTasksCanceller(logger *slog.Logger, client *http.Client, url *url.URL, enabled bool, maxRunning time.Duration, allow, deny []string) *TasksCanceller {
+	return &TasksCanceller{
+		logger:     logger,
+		client:     client,
+		url:        url,
+		enabled:    enabled,
+		maxRunning: maxRunning,
+		allow:      allow,
+		deny:       deny,
+
+		attempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "es_tasks_cancel_attempts_total",
+			Help: "Number of Elasticsearch task cancellation attempts, by action and result.",
+		}, []string{"action", "result"}),
+	}
+}
+
+func (c *TasksCanceller) Describe(ch chan<- *prometheus.Desc) {
+	c.attempts.Describe(ch)
+}
+
+func (c *TasksCanceller) Collect(ch chan<- prometheus.Metric) {
+	c.attempts.Collect(ch)
+}
+
+// ServeHTTP handles POST /control/tasks/cancel: it fetches the current
+// task list, cancels every eligible task, and reports the outcome of
+// each attempt as JSON.
+func (c *TasksCanceller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !c.enabled {
+		http.Error(w, "task cancellation is disabled; pass --es.tasks.cancel.enabled and --web.enable-lifecycle to allow it", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tasks, err := c.fetchTasks()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	results := c.cancelEligible(tasks)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		c.logger.Warn("failed to write task cancellation response", "err", err)
+	}
+}
+
+// RunReaper polls the task list every interval and cancels eligible
+// tasks in the background, until ctx is cancelled. It is a no-op while
+// c.enabled is false, so it is safe to always start.
+func (c *TasksCanceller) RunReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !c.enabled {
+				continue
+			}
+
+			tasks, err := c.fetchTasks()
+			if err != nil {
+				c.logger.Warn("task reaper failed to fetch tasks", "err", err)
+				continue
+			}
+			c.cancelEligible(tasks)
+		}
+	}
+}
+
+func (c *TasksCanceller) fetchTasks() (collector.TasksResponse, error) {
+	u := *c.url
+	u.Path = path.Join(u.Path, "/_tasks")
+
+	res, err := c.client.Get(u.String())
+	if err != nil {
+		return collector.TasksResponse{}, fmt.Errorf("failed to get from %s: %s", u.String(), err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return collector.TasksResponse{}, fmt.Errorf("HTTP request to %s failed with code %d", u.String(), res.StatusCode)
+	}
+
+	var tasks collector.TasksResponse
+	if err := json.NewDecoder(res.Body).Decode(&tasks); err != nil {
+		return collector.TasksResponse{}, fmt.Errorf("failed to decode tasks response: %s", err)
+	}
+	return tasks, nil
+}
+
+// cancelEligible walks every task in tasks and cancels those whose action
+// passes actionAllowed, that are cancellable and that have run longer
+// than maxRunning, recording the outcome of each attempt. Allowed tasks
+// that are not cancellable are recorded as skipped_not_cancellable
+// whatever their running time.
+func (c *TasksCanceller) cancelEligible(tasks collector.TasksResponse) []cancelResult {
+	var results []cancelResult
+
+	for nodeID, node := range tasks.Nodes {
+		for taskNumber, task := range node.Tasks {
+			// taskNumber is already the full "<node_id>:<task_number>"
+			// id Elasticsearch uses as the node.Tasks map key.
+			taskID := taskNumber
+
+			if !c.actionAllowed(task.Action) {
+				continue
+			}
+
+			if !task.Cancellable {
+				c.attempts.WithLabelValues(task.Action, "skipped_not_cancellable").Inc()
+				results = append(results, cancelResult{TaskID: taskID, Node: nodeID, Action: task.Action, Result: "skipped_not_cancellable"})
+				continue
+			}
+
+			running := time.Duration(task.RunningTimeInNanos) * time.Nanosecond
+			if running <= c.maxRunning {
+				continue
+			}
+
+			if err := c.cancelTask(taskID); err != nil {
+				c.attempts.WithLabelValues(task.Action, "failed").Inc()
+				results = append(results, cancelResult{TaskID: taskID, Node: nodeID, Action: task.Action, Result: "failed", Error: err.Error()})
+				c.logger.Warn("failed to cancel task", "task_id", taskID, "action", task.Action, "err", err)
+				continue
+			}
+
+			c.attempts.WithLabelValues(task.Action, "ok").Inc()
+			results = append(results, cancelResult{TaskID: taskID, Node: nodeID, Action: task.Action, Result: "ok"})
+		}
+	}
+
+	return results
+}
+
+// actionAllowed applies the allow/deny action-prefix lists: deny wins
+// over allow, and an empty allow list matches every action.
+func (c *TasksCanceller) actionAllowed(action string) bool {
+	for _, prefix := range c.deny {
+		if strings.HasPrefix(action, prefix) {
+			return false
+		}
+	}
+	if len(c.allow) == 0 {
+		return true
+	}
+	for _, prefix := range c.allow {
+		if strings.HasPrefix(action, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *TasksCanceller) cancelTask(taskID string) error {
+	u := *c.url
+	u.Path = path.Join(u.Path, "/_tasks", taskID, "_cancel")
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to build cancel request: %s", err)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to cancel task: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("cancel request failed with code %d", res.StatusCode)
+	}
+	return nil
+}
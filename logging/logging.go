@@ -0,0 +1,54 @@
+// Package logging wires the exporter's --log.format and --log.level
+// flags into a *slog.Logger, mirroring the logging flags exposed by
+// other Prometheus exporters.
+package logging
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+var (
+	logFormat = flag.String("log.format", "logfmt", "Output format of log messages. One of: [logfmt, json]")
+	logLevel  = flag.String("log.level", "info", "Only log messages with the given severity or above. One of: [debug, info, warn, error]")
+)
+
+// New builds a *slog.Logger from the --log.format and --log.level
+// flags. It must be called after flag.Parse.
+func New() (*slog.Logger, error) {
+	level, err := parseLevel(*logLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch *logFormat {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	case "logfmt":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return nil, fmt.Errorf("unrecognized log format %q, must be one of [logfmt, json]", *logFormat)
+	}
+
+	return slog.New(handler), nil
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	switch s {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unrecognized log level %q, must be one of [debug, info, warn, error]", s)
+	}
+}
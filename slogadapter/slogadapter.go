@@ -0,0 +1,59 @@
+// Package slogadapter bridges the go-kit/log.Logger interface to
+// log/slog, so that callers still holding onto a go-kit logger (e.g.
+// while the rest of a program is migrated incrementally) can keep
+// constructing collectors that now expect a *slog.Logger.
+package slogadapter
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"log/slog"
+)
+
+// FromGoKit wraps a go-kit/log.Logger as a *slog.Logger by routing every
+// slog record through a single gokitHandler. It exists purely as a
+// compile-time bridge for the go-kit -> slog migration; new callers
+// should construct a *slog.Logger directly instead.
+func FromGoKit(logger log.Logger) *slog.Logger {
+	return slog.New(&gokitHandler{logger: logger})
+}
+
+type gokitHandler struct {
+	logger log.Logger
+	attrs  []slog.Attr
+}
+
+func (h *gokitHandler) Enabled(_ context.Context, _ slog.Level) bool {
+	return true
+}
+
+func (h *gokitHandler) Handle(_ context.Context, record slog.Record) error {
+	kvs := []interface{}{"msg", record.Message}
+	for _, a := range h.attrs {
+		kvs = append(kvs, a.Key, a.Value.Any())
+	}
+	record.Attrs(func(a slog.Attr) bool {
+		kvs = append(kvs, a.Key, a.Value.Any())
+		return true
+	})
+
+	switch {
+	case record.Level >= slog.LevelError:
+		return level.Error(h.logger).Log(kvs...)
+	case record.Level >= slog.LevelWarn:
+		return level.Warn(h.logger).Log(kvs...)
+	case record.Level >= slog.LevelInfo:
+		return level.Info(h.logger).Log(kvs...)
+	default:
+		return level.Debug(h.logger).Log(kvs...)
+	}
+}
+
+func (h *gokitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &gokitHandler{logger: h.logger, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *gokitHandler) WithGroup(name string) slog.Handler {
+	return &gokitHandler{logger: log.With(h.logger, "group", name), attrs: h.attrs}
+}